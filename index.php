@@ -1,6 +1,7 @@
 <?php
 error_reporting (E_ALL ^ E_NOTICE); /* Turn off notice errors */
 require 'muximux.php';
+securityHeaders();
 if (is_session_started()) session_destroy();
 session_start();
 defined("CONFIG") ? null : define('CONFIG', 'settings.ini.php');
@@ -56,7 +57,7 @@ defined("CONFIG") ? null : define('CONFIG', 'settings.ini.php');
         </div>
     </div>
     <div class="loader-header">
-        <h4>Muximux is loading...</h4>
+        <h4><?php echo htmlspecialchars(getLoadingMessage()); ?></h4>
     </div>
     <div class="loader-body">
         <div class="loader">
@@ -111,6 +112,11 @@ defined("CONFIG") ? null : define('CONFIG', 'settings.ini.php');
                         <h3>General Settings (What does all this stuff do?)</h3>
                         <br>
                         <p>
+                        <h4> Loading Message</h4>
+                        The text shown while Muximux and your default application are loading.
+                        <br><br>
+                        </p>
+                        <p>
                         <h4> Git Branch</h4>
                         Select the branch to track on Github for updates.
                         <br><br>
@@ -151,18 +157,53 @@ defined("CONFIG") ? null : define('CONFIG', 'settings.ini.php');
                         <br><br>
                         </p>
                         <p>
+                        <h4> HSTS</h4>
+                        When enabled and Muximux is served over HTTPS, browsers are told to only ever connect to it over HTTPS for the number of seconds set in HSTS max-age (one year by default).  Only enable this once HTTPS works reliably for you.
+                        <br><br>
+                        </p>
+                        <p>
+                        <h4> HSTS preload</h4>
+                        Adds includeSubDomains and preload to the HSTS header, which is required to submit your domain to the browsers' HSTS preload list.  This applies to every subdomain of your domain and is hard to undo, so leave it off unless you mean to do that.
+                        <br><br>
+                        </p>
+                        <p>
+                        <h4> Embedding</h4>
+                        Choose where Muximux itself may be shown inside a frame: anywhere (for example inside another portal), only on pages from the same origin, or nowhere.
+                        <br><br>
+                        </p>
+                        <p>
+                        <h4> Opener policy</h4>
+                        Sets Cross-Origin-Opener-Policy.  "Same origin" keeps pages on other sites from holding a reference to the Muximux window, "Allow popups" does the same but still lets apps opened in a new tab keep theirs.
+                        <br><br>
+                        </p>
+                        <p>
+                        <h4> Embedder policy</h4>
+                        Sets Cross-Origin-Embedder-Policy.  "Require CORP" blocks every application that doesn't send a Cross-Origin-Resource-Policy header from loading in its frame, and "Credentialless" loads them without their cookies, which logs you out of most of them.  Leave this off unless all your applications support it.
+                        <br><br>
+                        </p>
+                        <p>
                         <h4> Use Authentication</h4>
-                        When enabled, you can set a username and password which will be required to log into Muximux.  Password is hashed, salted, and stored in settings, so your password is never stored in plain text.
+                        When enabled, you can set a username and password which will be required to log into Muximux.  Password is hashed, salted, and stored in settings, so your password is never stored in plain text.  New passwords must be at least as long as the minimum length, which can be raised but not set below 8 and must not contain the username.  Hash cost sets how much work goes into hashing the password, from 4 to 15 (10 by default); each step doubles the work, so raising it makes the stored hash harder to crack but logging in slower.  The stored hash is updated to a new cost the next time you log in.
                         <br><br>
                         </p>
                         <h3>Applications Settings (What does the rest of this stuff do?)</h3>
                         <br>
                         <p>
+                        <h4> Name</h4>
+                        The name shown in the menu.  Each application keeps its own section in the settings file whatever its name, but bookmarks find applications by name, so give each one a different name.  Section names in the settings file must stay unique with spaces, dots and opening brackets counted as underscores, so <code>[My app]</code> and <code>[My_app]</code> can't be used together.  The sections <code>[general]</code> and <code>[settings]</code> hold Muximux's own settings and can't be used for an application.
+                        <br><br>
+                        </p>
+                        <p>
                         <h4> URL</h4>
                         Enter the address of the page you want to load.  See below for instructions when serving Muximux over HTTPS.  Url should be fully formatted: 'http://www.address.com'.
                         <br><br>
                         </p>
                         <p>
+                        <h4> URL Variables</h4>
+                        A comma-separated list of <code>name=value</code> pairs, for example <code>host=nas.lan, port=8989</code>.  Any <code>{name}</code> in an application URL is replaced with its value, so <code>http://{host}:8989</code> becomes <code>http://nas.lan:8989</code>.  Change the value once to move all of your applications to a new address.  <code>{self}</code> is always replaced with the address you are browsing Muximux from.
+                        <br><br>
+                        </p>
+                        <p>
                         <h4> Zoom</h4>
                         Change the default zoom level for the application.  This value is used to scale the iframe contents in regards to the overall screen size.
                         <br><br>
@@ -193,6 +234,11 @@ defined("CONFIG") ? null : define('CONFIG', 'settings.ini.php');
                         <br><br>
                         </p>
                         <p>
+                        <h4> New tab</h4>
+                        Open the application in a new browser tab instead of inside Muximux.  Useful for applications that refuse to be loaded in a frame.  An application that opens in a new tab can not be the default application.
+                        <br><br>
+                        </p>
+                        <p>
                         <h4> Default</h4>
                         Enable this button to make the application the deafult selected item when Muximux is loaded.
                         <br><br>
@@ -291,6 +337,13 @@ defined("CONFIG") ? null : define('CONFIG', 'settings.ini.php');
             </div>
             <div class="modal-footer">
                 <div class='btn-group' role='group' aria-label='Buttons'>
+                    <select id="logLevel" class="form-control form-control-sm custom-select">
+                        <option value="">All</option>
+                        <option value="E">Errors</option>
+                        <option value="D">Debug</option>
+                        <option value="I">Info</option>
+                    </select>
+                    <input type="text" id="logSearch" class="form-control form-control-sm" placeholder="Search">
                     <button type='button' class="btn btn-default" id="logRefresh">Refresh</button>
                     <button type='button' class="btn btn-primary" data-dismiss="modal">Close</button>
                 </div>
@@ -332,7 +385,8 @@ defined("CONFIG") ? null : define('CONFIG', 'settings.ini.php');
 
 <?php
 
-if ($upgrade) echo "<script type=\"text/javascript\">$('#upgradeModal').modal();</script>"; ?>
+if ($upgrade) echo "<script type=\"text/javascript\">$('#upgradeModal').modal();</script>";
+if ($configRestored) echo "<script type=\"text/javascript\">setStatus('Your settings file could not be read, so it was restored from the backup taken before your last save. The changes made in that last save are lost and need to be made again. The broken file was kept as settings.broken.ini.php - see the log for details.');</script>"; ?>
 
     <meta id='secret'>
 
@@ -183,6 +183,11 @@ function settingsEventHandlers() {
 					'<input type="checkbox" class="form-check-input form-control ' + rand + 'newApplication_-_value" id="' + rand + 'newApplication_-_dd" name="' + rand + 'newApplication_-_dd">' + 
 				'</label>' +
 			'</div>' +
+			'<div class="appdiv form-group">' +
+				'<label for="' + rand + 'newApplication_-_newtab" class="col-xs-6 col-md-12 control-label col-form-label form-check-inline">New tab: ' +
+					'<input type="checkbox" class="form-check-input form-control ' + rand + 'newApplication_-_value" id="' + rand + 'newApplication_-_newtab" name="' + rand + 'newApplication_-_newtab">' + 
+				'</label>' +
+			'</div>' +
 			'<div class="appdiv form-group">' +
 				'<label for="' + rand + 'newApplication_-_default" class="col-xs-6 col-md-12 control-label col-form-label form-check-inline">Default: ' +
 					'<input type="radio" class="form-check-input form-control ' + rand + 'newApplication_-_value" id="' + rand + 'newApplication_-_default" name="' + rand + 'newApplication_-_default">' + 
@@ -234,11 +239,44 @@ function settingsEventHandlers() {
     var options = {
         url: 'muximux.php',
         type: 'post',
-        success: showResponse
+        success: showResponse,
+        error: showError
     };
     $('#settingsSubmit').click(function(event) {
         event.preventDefault();
         $('.newApp').remove(); //Remove any new app that isn't filled out.
+        // Each application's fields are posted as <section>_-_<setting>, where the section is the one it was loaded from
+        // (or a random one for new applications), not its name. PHP turns spaces, dots and [ in posted field names into
+        // underscores, so two sections that end up the same would silently overwrite each other.
+        // The "general" and "settings" sections hold Muximux's own settings.
+        var reserved = {general: true, settings: true};
+        var sections = {};
+        var duplicate = false;
+        var reservedSection = false;
+        $('.appName').each(function() {
+            var section = $(this).attr('name').split('_-_')[0].replace(/[ .\[]/g, '_');
+            if (reserved[section]) reservedSection = section;
+            if (sections[section]) duplicate = $(this).val();
+            sections[section] = true;
+        });
+        if (reservedSection) {
+            alert('An application can not be saved in the "' + reservedSection + '" section, it holds Muximux\'s own settings. Rename the section in settings.ini.php and try again.');
+            return;
+        }
+        if (duplicate) {
+            alert('The application "' + duplicate + '" would be saved over another section of the settings file. Fix the section names in settings.ini.php and try again.');
+            return;
+        }
+        // The default application is shown when Muximux loads, which an application opening in a new tab can't be.
+        var defaultNewtab = false;
+        $('input[name$="_-_default"]:checked').each(function() {
+            var app = $(this).attr('name').slice(0, -'_-_default'.length);
+            if ($('input[name="' + app + '_-_newtab"]').prop('checked')) defaultNewtab = true;
+        });
+        if (defaultNewtab) {
+            alert('An application that opens in a new tab can not be the default application. Pick another default or turn off New tab and try again.');
+            return;
+        }
         $('.checkbox,.radio').each(function() {
             if (!$(this).prop('checked')) {
                 var name = $(this).attr('name');
@@ -246,6 +284,9 @@ function settingsEventHandlers() {
             }
         });
         $('.appName').removeAttr('disabled');
+        options.data = {
+            token: $("#token").attr('data')
+        };
         $("form").ajaxSubmit(options);
     });
     $('#tabcolorCheckbox').click(function(event) {
@@ -358,6 +399,10 @@ function showResponse(responseText, statusText) {
     if (responseText == 1 || statusText == "success") location.pathname = location.pathname;
     else alert("Error!!!-" + responseText);
 }
+// Settings were rejected by the server, tell the user why and leave the settings open so they can fix it.
+function showError(xhr) {
+    alert("Settings were not saved: " + xhr.responseText);
+}
 // Calculates the amount of days since an update was commited on Github.
 function datediff(latestDate) {
     var githubDate_ms = new Date(latestDate).getTime();
@@ -519,10 +564,12 @@ function write_log($text,$lvl) {
 
 function refresh_log() {
     var secret = $("#secret").attr('data');
+    var lvl = $("#logLevel").val();
+    var search = $("#logSearch").val();
         $.ajax({
             async: true,
             dataType: 'text',
-            url: "muximux.php?secret=" + secret + "&action=log",
+            url: "muximux.php?secret=" + secret + "&action=log" + (lvl ? "&lvl=" + lvl : "") + (search ? "&q=" + encodeURIComponent(search) : ""),
             type: 'GET',
             success: function(html) {
                 $('#logContainer').replaceWith(html);
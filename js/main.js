@@ -91,6 +91,11 @@ jQuery(document).ready(function($) {
             resizeIframe(hasDrawer, isMobile); // Call resizeIframe when document is ready
             event.preventDefault();
             var selectedItem = $(this);
+            // Apps set to open in a new tab don't get a frame of their own
+            if (selectedItem.attr("data-newtab") == "true") {
+                window.open(parseRelativeUrlWithPortIfPresent(selectedItem.attr("data-url")), '_blank');
+                return;
+            }
             if (tabColor) {
                 color = selectedItem.attr("data-color");
             } else {
@@ -226,6 +231,14 @@ jQuery(document).ready(function($) {
         refresh_log();
 
     });
+    $('#logLevel').on('change', function() {
+        refresh_log();
+    });
+    $('#logSearch').on('keypress', function(e) {
+        if (e.which == 13) {
+            refresh_log();
+        }
+    });
     $('#refreshLog').on('click', function() {
         $('#logContainer').slideToggle();
         refresh_log();
@@ -271,8 +284,19 @@ jQuery(document).ready(function($) {
     initIconPicker('.iconpicker');
     // Load the menu item that is set in URL, for example http://site.com/#plexpy
     if ($(location).attr('hash')) {
-        var bookmarkHash = $(location).attr('hash').substr(1).replace("%20", " ").replace("_", " ");
-        var menuItem = $(document).find('a:containsInsensitive("' + bookmarkHash + '")');
+        // Browsers percent-encode anything outside of ASCII in the hash, so decode it to match names like "Плекс" or "媒体"
+        var bookmarkHash = $(location).attr('hash').substr(1);
+        try {
+            bookmarkHash = decodeURIComponent(bookmarkHash);
+        } catch (e) {
+            // Not valid percent-encoding, use the hash as it is.
+        }
+        bookmarkHash = bookmarkHash.split("_").join(" ");
+        // Opening a new tab without a click gets stopped by popup blockers, so bookmarks only select apps shown inside Muximux.
+        // Match on the text rather than building a selector, a decoded hash can hold quotes or backslashes.
+        var menuItem = $('a').filter(function() {
+            return $(this).text().toLowerCase().indexOf(bookmarkHash.toLowerCase()) >= 0;
+        }).not('[data-newtab="true"]');
         menuItem.trigger("click");
     }
     
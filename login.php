@@ -20,6 +20,15 @@ if(isset($_GET['logout'])) {
 if(isset($_POST['username'])) {
     if ($_POST['username'] == $username && password_verify($_POST['password'],$hash)) {
 		$_SESSION['username'] = $_POST['username'];
+		// Re-hash the password if the hash cost was changed since it was last set
+		if (password_needs_rehash($hash, PASSWORD_BCRYPT, array('cost' => getPasswordCost()))) {
+			$config->set('general', 'password', password_hash($_POST['password'], PASSWORD_BCRYPT, array('cost' => getPasswordCost())));
+			if (saveConfig($config)) {
+				write_log('Updated password hash to the configured cost.','I');
+			} else {
+				write_log('Could not save the password hash with the configured cost.','E');
+			}
+		}
 		header('Location:  ' . $_SERVER['PHP_SELF']);
 		write_log('Successfully logged in.');
 		exit();
@@ -7,6 +7,9 @@ defined("CONFIGEXAMPLE") ? null : define('CONFIGEXAMPLE', 'settings.ini.php-exam
 defined("SECRET") ? null : define('SECRET', 'secret.txt');
 require dirname(__FILE__) . '/vendor/autoload.php';
 
+// Log anything we didn't catch ourselves instead of leaving the user with a white page.
+set_exception_handler('exceptionHandler');
+
 // Check if this is an old installation that needs upgrading.
 if (file_exists('config.ini.php')) {
     copy('config.ini.php', 'backup.ini.php');
@@ -23,13 +26,69 @@ if(!file_exists(CONFIG)){
     checksetSHA();
 }
 
+// Make sure the config is something we can actually read before anything tries to use it.
+$configRestored = checkConfig();
+
 // First what we're gonna do - save or read
 if (sizeof($_POST) > 0) {
     if(!isset($_POST['username'])){
+        // Settings can only be saved by a page that was handed this session's token, so other sites can't post them for you.
+        if (!is_session_started()) session_start();
+        if (!isset($_POST['token']) || !isset($_SESSION['token']) || !hash_equals($_SESSION['token'], $_POST['token'])) {
+            write_log('Refused to save settings, the request did not include a valid token.','E');
+            header('HTTP/1.1 403 Forbidden');
+            echo 'Your session has expired, reload the page and try again.';
+            die;
+        }
+        unset($_POST['token']);
         write_ini();
     }
 }
 
+// Check that the config file is a readable, parseable file. If it can't be parsed but the backup can, the backup
+// (the config as it was before the last save) is put back and true is returned. Otherwise, tell the user how to recover
+// instead of failing somewhere further down with a white page.
+function checkConfig() {
+    $message = false;
+    $backup = configFile('bak');
+    $broken = configFile('broken');
+    if (is_dir(CONFIG)) {
+        $message = CONFIG . ' is a directory, not a file. This usually happens when a Docker volume is mounted before the file exists.';
+        $message .= '  Remove the directory and reload this page, and a fresh ' . CONFIG . ' will be created from ' . CONFIGEXAMPLE . '.';
+    } else if (!is_readable(CONFIG)) {
+        $message = 'The file ' . CONFIG . ' is not readable by the PHP process. Check the permissions & ownership and reload this page.';
+    } else if (@parse_ini_file(CONFIG, true) === false) {
+        $error = error_get_last();
+        copy(CONFIG, $broken);
+        chmod($broken, fileperms(CONFIG) & 0777);
+        if (file_exists($backup) && (@parse_ini_file($backup, true) !== false)) {
+            copy($backup, CONFIG);
+            write_log('The file ' . CONFIG . ' could not be parsed, restored it from the backup taken before the last save, so the changes from that save are lost. The broken file has been kept as ' . $broken . '.','E');
+            return true;
+        }
+        $message = 'The file ' . CONFIG . ' could not be parsed' . (isset($error['message']) ? ': ' . $error['message'] : '.');
+        $message .= '  A copy has been kept as ' . $broken . '. Fix the file by hand, or replace it with ' . (file_exists('backup.ini.php') ? 'backup.ini.php' : CONFIGEXAMPLE) . ', then reload this page.';
+    }
+    if ($message !== false) {
+        write_log($message,'E');
+        header('HTTP/1.1 500 Internal Server Error');
+        die('<p>' . htmlspecialchars($message) . '</p>');
+    }
+    return false;
+}
+
+// The file our config really lives in. In Docker settings.ini.php is a symlink into the /config volume,
+// and anything we write next to the config has to end up there too.
+// Pass a type (bak, tmp, broken) to get the name of a file kept next to it, e.g. settings.bak.ini.php. These keep
+// the .php extension so the web server won't hand them out as plain text.
+function configFile($type = '') {
+    $file = ((is_link(CONFIG) && realpath(CONFIG)) ? realpath(CONFIG) : CONFIG);
+    if ($type != '') {
+        $file = (preg_match('/\.ini\.php$/', $file) ? substr($file, 0, -8) . '.' . $type . '.ini.php' : $file . '.' . $type);
+    }
+    return $file;
+}
+
 // Check if we can open a file.
 function openFile($file, $mode) {
     if ((file_exists($file) && (!is_writable(dirname($file)) || !is_writable($file))) || !is_writable(dirname($file))) { // If file exists, check both file and directory writeable, else check that the directory is writeable.
@@ -57,6 +116,14 @@ function createSecret() {
     return $text;
 }
 
+// Fetch the token for this session, creating it the first time. Saving settings requires it.
+function getToken() {
+    if (!isset($_SESSION['token'])) {
+        $_SESSION['token'] = (function_exists('random_bytes') ? bin2hex(random_bytes(16)) : sha1(uniqid(mt_rand(), true)));
+    }
+    return $_SESSION['token'];
+}
+
 // Save our settings on submit
 function write_ini()
 {
@@ -73,8 +140,36 @@ function write_ini()
 	    die;
 	}
     }
-	unlink(CONFIG);
-    $config = new Config_Lite(CONFIG);
+    // The minimum length comes in with the password it's checked against, so make sure it can't be lowered below 8
+    if (isset($_POST['general_-_passwordminlength']) && (!ctype_digit((string)$_POST['general_-_passwordminlength']) || ($_POST['general_-_passwordminlength'] < 8))) {
+        write_log('Settings were not saved, the minimum password length must be a number of at least 8.','E');
+        header('HTTP/1.1 400 Bad Request');
+        echo 'The minimum password length must be a number of at least 8.';
+        die;
+    }
+    // Check a new password against the password rules before we throw away the old config
+    $newPassword = (isset($_POST['general_-_password']) ? $_POST['general_-_password'] : $oldHash);
+    if ($newPassword != $oldHash) {
+        $newUserName = (isset($_POST['general_-_userNameInput']) ? $_POST['general_-_userNameInput'] : $config->get('general', 'userNameInput', 'admin'));
+        $minLength = (isset($_POST['general_-_passwordminlength']) ? $_POST['general_-_passwordminlength'] : $config->get('general', 'passwordminlength', 8));
+        $result = checkPassword($newPassword, $newUserName, max(8, intval($minLength)));
+        if ($result !== true) {
+            write_log('Password was not updated: ' . $result,'E');
+            header('HTTP/1.1 400 Bad Request');
+            echo $result;
+            die;
+        }
+    }
+    // A new password is hashed with the cost posted along with it, so check that cost before we throw away the old config
+    $passwordCost = (isset($_POST['general_-_passwordcost']) ? $_POST['general_-_passwordcost'] : null);
+    if (($passwordCost !== null) && (!ctype_digit((string)$passwordCost) || ($passwordCost < 4) || ($passwordCost > 15))) {
+        write_log('Settings were not saved, the hash cost must be a number from 4 to 15.','E');
+        header('HTTP/1.1 400 Bad Request');
+        echo 'The hash cost must be a number from 4 to 15.';
+        die;
+    }
+    // Start from an empty config, the old file is only replaced once the new one has been written in full.
+    $config->clear();
     foreach ($_POST as $parameter => $value) {
         $splitParameter = explode('_-_', $parameter);
         $value = (($value == "on") ? "true" : $value );
@@ -82,7 +177,7 @@ function write_ini()
 			case "password":
 				if ($value != $oldHash) {
 					write_log('Successfully updated password.','I');
-					$value = password_hash($value, PASSWORD_BCRYPT);
+					$value = password_hash($value, PASSWORD_BCRYPT, array('cost' => getPasswordCost($passwordCost)));
 					$terminate = true;
 				}
 			break;
@@ -107,21 +202,52 @@ function write_ini()
         $config->set($splitParameter[0], $splitParameter[1], $value);
     }
     // save object to file
-    saveConfig($config);
+    if (!saveConfig($config)) {
+        header('HTTP/1.1 500 Internal Server Error');
+        echo 'The settings file could not be written. Check the log for details.';
+        die;
+    }
     if ($terminate) {
-        session_start();
+        if (!is_session_started()) session_start();
         session_destroy();
     }
 }
 
-// set $_SERVER['HTTP_HOST'] when {self}
+// Check a new password against our password rules. Returns true if it's fine, otherwise a message saying why it isn't.
+function checkPassword($password, $userName, $minLength) {
+    if (mb_strlen($password, 'UTF-8') < $minLength) {
+        return 'The password must be at least ' . $minLength . ' characters long.';
+    }
+    if (($userName != '') && (stripos($password, $userName) !== false)) {
+        return 'The password must not contain the username.';
+    }
+    return true;
+}
+
+// set $_SERVER['HTTP_HOST'] when {self}, and replace any {name} set in the URL variables setting
 function selfURL_managment ($url) {
 	if  (strpos($url,'{self}')  !== FALSE) {
 		$url = str_replace('{self}',$_SERVER['HTTP_HOST'],$url);
 	}
+	foreach (getUrlVars() as $name => $value) {
+		$url = str_replace('{' . $name . '}',$value,$url);
+	}
 	return $url;
 }
 
+// Parse the URL variables setting ("host=nas.lan, port=8989") into an array of name => value
+function getUrlVars() {
+    $config = new Config_Lite(CONFIG);
+    $vars = array();
+    foreach (explode(',', $config->get('general', 'urlvars', '')) as $pair) {
+        $splitPair = explode('=', $pair, 2);
+        if ((count($splitPair) == 2) && (trim($splitPair[0]) != '') && (trim($splitPair[0]) != 'self')) {
+            $vars[trim($splitPair[0])] = trim($splitPair[1]);
+        }
+    }
+    return $vars;
+}
+
 // Parse settings.php and create the Muximux elements
 function parse_ini()
 {
@@ -142,9 +268,18 @@ function parse_ini()
     $splashScreen = $config->getBool('general', 'splashscreen', false);
     $userName = $config->get('general', 'userNameInput', 'admin');
     $passHash = $config->get('general', 'password', 'Muximux');
+    $passwordMinLength = $config->get('general', 'passwordminlength', 8);
+    $passwordCost = getPasswordCost();
     $authentication = $config->getBool('general', 'authentication', false);
     $rss = $config->getBool('general', 'rss', false);
 	$rssUrl = $config->get('general','rssUrl','https://www.wired.com/feed/');
+    $urlVars = $config->get('general', 'urlvars', '');
+    $hsts = $config->getBool('general', 'hsts', false);
+    $hstsMaxAge = $config->get('general', 'hstsmaxage', 31536000);
+    $hstsPreload = $config->getBool('general', 'hstspreload', false);
+    $frameOptions = $config->get('general', 'frameoptions', '');
+    $coop = $config->get('general', 'coop', '');
+    $coep = $config->get('general', 'coep', '');
     $myBranch = getBranch();
 
     foreach ($branchArray as $branchName => $shaSum ) {
@@ -152,6 +287,7 @@ function parse_ini()
                                 <option value='".$branchName."' ".(($myBranch == $branchName) ? 'selected' : '' ).">". $branchName ."</option>";
     }
     $title = $config->get('general', 'title', 'Muximux - Application Management Console');
+    $loadingMessage = getLoadingMessage();
     $pageOutput = "<form class='form-inline'>
 
 						<div class='applicationContainer row generalContainer' style='cursor:default;'>
@@ -162,6 +298,12 @@ function parse_ini()
 								<input id='titleInput' type='text' class='form-control form-control-sm' general_-_value' name='general_-_title' value='" . $title . "'>
 							</div>
                         </div>
+                        <div class='appDiv form-group'>
+                            <label for='loadingMessageInput' class='col-xs-6 col-sm-4 col-md-4 control-label left-label'>Loading message: </label>
+							<div class='col-xs-6 col-sm-8 col-md-8'>
+								<input id='loadingMessageInput' type='text' class='form-control form-control-sm general_-_value' name='general_-_loadingmessage' value='" . htmlspecialchars($loadingMessage, ENT_QUOTES) . "'>
+							</div>
+                        </div>
                         <div class='appDiv form-group'>
 							<label for='branch'  class='col-xs-6 col-sm-5 col-md-5 control-label left-label'>Git branch: </label>
 							<div class='col-xs-6 col-sm-2 col-md-2'>
@@ -183,6 +325,12 @@ function parse_ini()
 							<div class='col-xs-6 col-sm-7 col-md-7'>
 								<input type='text' id='general_-_default' class='appsColor generalColor general_-_color' value='".$themeColor."' name='general_-_color'>
 							</div>
+                        </div>
+                        <div class='appDiv form-group'>
+                            <label for='urlVarsInput' class='col-xs-6 col-sm-4 col-md-4 control-label left-label'>URL variables: </label>
+							<div class='col-xs-6 col-sm-8 col-md-8'>
+								<input id='urlVarsInput' type='text' class='form-control form-control-sm general_-_value' name='general_-_urlvars' placeholder='host=nas.lan, port=8989' value='" . htmlspecialchars($urlVars, ENT_QUOTES) . "'>
+							</div>
                         </div>
 						<div class='hidden-xl-up'>
 							<br>
@@ -212,6 +360,52 @@ function parse_ini()
 								<input id='autohideCheckbox' class='form-check-input form-control general_-_value' name='general_-_autohide' type='checkbox' ".($autoHide ? 'checked' : '').">
 							</label>
 						</div>
+                        <div class='appDiv form-group'>
+                            <label for='hstsCheckbox' class='col-xs-6 col-sm-12 control-label col-form-label form-check-inline'>HSTS:
+								<input id='hstsCheckbox' class='form-check-input form-control general_-_value' name='general_-_hsts' type='checkbox' ".($hsts ? 'checked' : '').">
+							</label>
+                        </div>
+						<div class='appDiv form-group'>
+							<label for='hstsMaxAgeInput' class='col-xs-6 col-sm-4 col-md-4 control-label left-label'>HSTS max-age: </label>
+							<div class='col-xs-6 col-sm-2 col-md-2'>
+								<input id='hstsMaxAgeInput' type='number' min='0' class='form-control general_-_value' name='general_-_hstsmaxage' value='" . $hstsMaxAge . "'>
+							</div>
+						</div>
+                        <div class='appDiv form-group'>
+                            <label for='hstsPreloadCheckbox' class='col-xs-6 col-sm-12 control-label col-form-label form-check-inline'>HSTS preload:
+								<input id='hstsPreloadCheckbox' class='form-check-input form-control general_-_value' name='general_-_hstspreload' type='checkbox' ".($hstsPreload ? 'checked' : '').">
+							</label>
+                        </div>
+						<div class='appDiv form-group'>
+							<label for='frameoptions' class='col-xs-6 col-sm-4 col-md-4 control-label left-label'>Embedding: </label>
+							<div class='col-xs-6 col-sm-2 col-md-2'>
+								<select id='frameoptions' class='form-control form-control-sm custom-select general_-_value' name='general_-_frameoptions'>
+									<option value='' ".(($frameOptions == '') ? 'selected' : '').">Anywhere</option>
+									<option value='SAMEORIGIN' ".(($frameOptions == 'SAMEORIGIN') ? 'selected' : '').">Same origin</option>
+									<option value='DENY' ".(($frameOptions == 'DENY') ? 'selected' : '').">Nowhere</option>
+								</select>
+							</div>
+						</div>
+						<div class='appDiv form-group'>
+							<label for='coop' class='col-xs-6 col-sm-4 col-md-4 control-label left-label'>Opener policy: </label>
+							<div class='col-xs-6 col-sm-2 col-md-2'>
+								<select id='coop' class='form-control form-control-sm custom-select general_-_value' name='general_-_coop'>
+									<option value='' ".(($coop == '') ? 'selected' : '').">Off</option>
+									<option value='same-origin-allow-popups' ".(($coop == 'same-origin-allow-popups') ? 'selected' : '').">Allow popups</option>
+									<option value='same-origin' ".(($coop == 'same-origin') ? 'selected' : '').">Same origin</option>
+								</select>
+							</div>
+						</div>
+						<div class='appDiv form-group'>
+							<label for='coep' class='col-xs-6 col-sm-4 col-md-4 control-label left-label'>Embedder policy: </label>
+							<div class='col-xs-6 col-sm-2 col-md-2'>
+								<select id='coep' class='form-control form-control-sm custom-select general_-_value' name='general_-_coep'>
+									<option value='' ".(($coep == '') ? 'selected' : '').">Off</option>
+									<option value='credentialless' ".(($coep == 'credentialless') ? 'selected' : '').">Credentialless</option>
+									<option value='require-corp' ".(($coep == 'require-corp') ? 'selected' : '').">Require CORP</option>
+								</select>
+							</div>
+						</div>
                         <div class='appDiv form-group'>
                             <label for='authenticationCheckbox' class='col-xs-6 col-sm-12 control-label col-form-label form-check-inline'>Authentication:
 								<input id='authenticationCheckbox' class='form-check-input form-control general_-_value' name='general_-_authentication' type='checkbox' ".($authentication ? 'checked' : '').">
@@ -241,6 +435,18 @@ function parse_ini()
 									<input id='passwordInput' type='password' autocomplete='new-password' class='form-control' general_-_value' name='general_-_password' value='" . $passHash . "'>
 								</div>
 							</div>
+							<div class='userinput appDiv form-group'>
+								<label for='passwordMinLengthInput' class='col-xs-4 control-label right-label'>Min. length: </label>
+								<div class='col-xs-7 col-sm-5 col-md-8'>
+									<input id='passwordMinLengthInput' type='number' min='8' class='form-control general_-_value' name='general_-_passwordminlength' value='" . $passwordMinLength . "'>
+								</div>
+							</div>
+							<div class='userinput appDiv form-group'>
+								<label for='passwordCostInput' class='col-xs-4 control-label right-label'>Hash cost: </label>
+								<div class='col-xs-7 col-sm-5 col-md-8'>
+									<input id='passwordCostInput' type='number' min='4' max='15' class='form-control general_-_value' name='general_-_passwordcost' value='" . $passwordCost . "'>
+								</div>
+							</div>
 						</div>
                     </div>
 
@@ -265,6 +471,7 @@ function parse_ini()
             $enabled = $config->getBool($section, 'enabled', true);
             $landingpage = $config->getBool($section, 'landingpage', false);
             $dd = $config->getBool($section, 'dd', false);
+            $newtab = $config->getBool($section, 'newtab', false);
             $scaleRange = "0";
             $scaleRange = buildScale($scale);
             $pageOutput .= "
@@ -319,6 +526,11 @@ function parse_ini()
 									<input type='checkbox' class='form-check-input form-control " . $section . "_-_value' id='" . $section . "_-_dd' name='" . $section . "_-_dd'".($dd ? 'checked' : '') .">
 								</label>
 							</div>
+							<div class='appDiv form-group'>
+								<label for='" . $section . "_-_newtab' class='col-xs-6 col-md-12 control-label col-form-label form-check-inline'>New tab:
+									<input type='checkbox' class='form-check-input form-control " . $section . "_-_value' id='" . $section . "_-_newtab' name='" . $section . "_-_newtab'".($newtab ? 'checked' : '') .">
+								</label>
+							</div>
 							<div class='appDiv form-group'>
 								<label for='" . $section . "_-_default' class='col-xs-6 col-md-12 control-label col-form-label form-check-inline'>Default:
 									<input type='radio' class='form-check-input form-control " . $section . "_-_value' id='" . $section . "_-_default' name='" . $section . "_-_default'".($default ? 'checked' : '') .">
@@ -374,56 +586,47 @@ function splashScreen() {
 }
 
 // Generate the contents of the log
-function log_contents() {
+// Optionally only show entries of a given level (E, D or I) and/or entries containing a search string.
+// Lines without a level prefix (e.g. stack traces) belong to the entry above them and are filtered along with it.
+function log_contents($level = null, $search = null) {
     $out = '<ul>
                 <div id="logContainer">
     ';
     $filename = 'muximux.log';
 	$file = file($filename);
-	$file = array_reverse($file);
-	$lineOut = "";
-	$concat = false;
+	$entries = array();
 	foreach($file as $line){
 		$lvl = substr($line,0,2);
-		if (substr($lvl,1,1) == "/") {
-			switch ($lvl) {
-				case "E/":
-					$color = 'alert alert-danger';
-					break;
-				case "D/":
-					$color = 'alert alert-warning';
-					break;
-				case "I/":
-					$color = 'alert alert-success';
-					break;
-				case "":
-					$color = 'alert alert-info';
-					break;
-			}
-			if ($concat === true) {
-			$out .='
-                        <li class="logLine alert alert-info">'.
-                            $lineOut.'
-                        </li>';
-			}
-
-
-
-			$lineOut = substr($line,2);
-			$concat = false;
-
+		if ((substr($lvl,1,1) == "/") || empty($entries)) {
+			$entries[] = array('level' => ((substr($lvl,1,1) == "/") ? substr($lvl,0,1) : ''), 'text' => ((substr($lvl,1,1) == "/") ? substr($line,2) : $line));
 		} else {
-			$lineOut .= $line;
-			$concat = true;
+			$entries[count($entries) - 1]['text'] .= $line;
 		}
-		if ($concat === false) {
-			$out .='
+	}
+	// The log is escaped when written, so escape the search the same way for it to match.
+	$search = (empty($search) ? $search : htmlspecialchars($search));
+	foreach(array_reverse($entries) as $entry){
+		if ((!empty($level) && ($entry['level'] != $level)) || (!empty($search) && (stripos($entry['text'],$search) === false))) {
+			continue;
+		}
+		switch ($entry['level']) {
+			case "E":
+				$color = 'alert alert-danger';
+				break;
+			case "D":
+				$color = 'alert alert-warning';
+				break;
+			case "I":
+				$color = 'alert alert-success';
+				break;
+			default:
+				$color = 'alert alert-info';
+				break;
+		}
+		$out .='
                         <li class="logLine '.$color.'">'.
-                            $lineOut.'
+                            $entry['text'].'
                         </li>';
-
-		}
-
     }
     $out .= '</div>
             </ul>
@@ -436,7 +639,9 @@ function log_contents() {
 function checkBranchChanged() {
     $config = new Config_Lite(CONFIG);
     if ($config->getBool('settings', 'branch_changed', false)) {
-        saveConfig($config);
+        if (!saveConfig($config)) {
+            write_log('Could not save the configuration after the branch was changed.','E');
+        }
 	checksetSHA();
         return true;
     } else {
@@ -543,13 +748,15 @@ function menuItems() {
             $enabled = $config->getBool($keyname, 'enabled', false);
             $landingpage = $config->getBool($keyname, 'landingpage', false);
             $dd = $config->getBool($keyname, 'dd', false);
+            $newtab = $config->getBool($keyname, 'newtab', false);
+            $newtabData = ($newtab ? " data-newtab='true' data-url='" . selfURL_managment($url) . "'" : '');
 
 			if ($enabled) {
 				if ($dropdown) {
 					if (!$dd) {
 						$standardmenu .= "
 							<li class='cd-tab' data-index='".$int."'>
-								<a data-content='" . $keyname . "' data-title='" . $section["name"] . "' data-color='" . $section["color"] . "' class='".($default ? 'selected' : '')."'>
+								<a data-content='" . $keyname . "' data-title='" . $section["name"] . "' data-color='" . $section["color"] . "'" . $newtabData . " class='".(($default && !$newtab) ? 'selected' : '')."'>
 									<span class='fa " . $icon . " fa-lg'></span> " . $section["name"] . "
 								</a>
 							</li>";
@@ -557,7 +764,7 @@ function menuItems() {
 					} else {
 						$dropdownmenu .= "
 							<li>
-								<a data-content='" . $keyname . "' data-title='" . $section["name"] . "'>
+								<a data-content='" . $keyname . "' data-title='" . $section["name"] . "'" . $newtabData . ">
 									<span class='fa " . $icon . "'></span> " . $section["name"] . "
 								</a>
 							</li>";
@@ -626,6 +833,32 @@ function menuItems() {
     return $item;
 }
 
+// Send the security headers chosen in settings. Must be called before any output.
+function securityHeaders() {
+    $config = new Config_Lite(CONFIG);
+    $frameOptions = $config->get('general', 'frameoptions', '');
+    if (in_array($frameOptions, array('SAMEORIGIN', 'DENY'))) {
+        header('X-Frame-Options: ' . $frameOptions);
+        header("Content-Security-Policy: frame-ancestors " . (($frameOptions == 'SAMEORIGIN') ? "'self'" : "'none'"));
+    }
+    // Browsers ignore HSTS over plain HTTP, so only send it when we're actually served over HTTPS.
+    // Preload lists only take sites that cover their subdomains, so preload implies includeSubDomains.
+    if ($config->getBool('general', 'hsts', false) && !empty($_SERVER['HTTPS']) && ($_SERVER['HTTPS'] != 'off')) {
+        $maxAge = max(0, intval($config->get('general', 'hstsmaxage', 31536000)));
+        $preload = $config->getBool('general', 'hstspreload', false);
+        header('Strict-Transport-Security: max-age=' . $maxAge . ($preload ? '; includeSubDomains; preload' : ''));
+    }
+    $coop = $config->get('general', 'coop', '');
+    if (in_array($coop, array('same-origin', 'same-origin-allow-popups'))) {
+        header('Cross-Origin-Opener-Policy: ' . $coop);
+    }
+    $coep = $config->get('general', 'coep', '');
+    if (in_array($coep, array('require-corp', 'credentialless'))) {
+        header('Cross-Origin-Embedder-Policy: ' . $coep);
+    }
+    header('X-Content-Type-Options: nosniff');
+}
+
 // Quickie fetch the main title
 function getTitle() {
     $config = new Config_Lite(CONFIG);
@@ -633,6 +866,13 @@ function getTitle() {
     return $item;
 
 }
+// Quickie fetch of the message shown while Muximux is loading
+function getLoadingMessage() {
+    $config = new Config_Lite(CONFIG);
+    $item = $config->get('general', 'loadingmessage', 'Muximux is loading...');
+    return $item;
+}
+
 // Quickie fetch of the current selected branch
 function getBranch() {
     $config = new Config_Lite(CONFIG);
@@ -698,7 +938,9 @@ function fetchBranches($skip) {
             $outP = array_combine($names,$shas);
             $config ->set('settings','branches',$outP);
             $config ->set('settings','last_check',time());
-            saveConfig($config);
+            if (!saveConfig($config)) {
+                write_log('Could not save the list of branches to the configuration.','E');
+            }
             $result = true;
         }
 
@@ -748,8 +990,9 @@ function checksetSHA() {
 		$changed = true;
 	}
 	if ($changed) {
-		saveConfig($config);
-
+		if (!saveConfig($config)) {
+			write_log('Could not save the current SHA to the configuration.','E');
+		}
 	}
 }
 
@@ -760,6 +1003,16 @@ function getSHA() {
     return $item;
 }
 
+// Quickie fetch of the bcrypt cost used when hashing passwords, or of a given cost, kept between 4 and 15.
+// password_hash() accepts up to 31, but anything past 15 makes logging in take minutes to days.
+function getPasswordCost($cost = null) {
+    if ($cost === null) {
+        $config = new Config_Lite(CONFIG);
+        $cost = $config->get('general', 'passwordcost', 10);
+    }
+    return max(4, min(15, intval($cost)));
+}
+
 // Retrieve password hash from settings and return it for "stuff".
 function getPassHash() {
     $config = new Config_Lite(CONFIG);
@@ -811,6 +1064,7 @@ $tags = "
     <meta id='created-data' data='". $created . "'>
     <meta id='sha-data' data='". getSHA() . "'>
     <meta id='secret' data='". $secret . "'>
+    <meta id='token' data='". getToken() . "'>
     <meta id='themeColor-data' data='". $themeColor . "'>
     <meta id='splashScreen-data' data='". $splashScreen . "'>
     <meta id='authentication-data' data='". $authentication . "'>
@@ -828,11 +1082,12 @@ function frameContent() {
     $landingpage = $config->getBool($keyname,'landingpage',false);
     $enabled = $config->getBool($keyname,'enabled',true);
     $default = $config->getBool($keyname,'default',false);
+    $newtab = $config->getBool($keyname,'newtab',false);
     $scale = $config->get($keyname,'scale',1);
     $url = $section["url"];
     $url = selfURL_managment($url);
     $url=($landingpage ? "?landing=" . $keyname: $url);
-    if ($enabled && ($keyname != 'settings') && ($keyname != 'general')) {
+    if ($enabled && !$newtab && ($keyname != 'settings') && ($keyname != 'general')) {
 		$item .= "
 				<li data-content='" . $keyname . "' data-scale='" . $section["scale"] ."' ".($default ? "class='selected'" : '').">
 					<iframe sandbox='allow-forms allow-same-origin allow-pointer-lock allow-scripts allow-downloads allow-popups allow-modals allow-top-navigation'
@@ -856,7 +1111,7 @@ function landingPage($keyname) {
         <div class='heading'>
             <h2><span class='fa " . $config->get($keyname, 'icon') . " fa-3x'></span></h2>
             <section>
-                <a href='" . $config->get($keyname, 'url') . "' target='_self' title='Launch " . $config->get($keyname, 'name') . "!'><button class='float'>Launch " . $config->get($keyname, 'name') . "</button></a>
+                <a href='" . selfURL_managment($config->get($keyname, 'url')) . "' target='_self' title='Launch " . $config->get($keyname, 'name') . "!'><button class='float'>Launch " . $config->get($keyname, 'name') . "</button></a>
             </section>
         </div>
      </div>
@@ -953,7 +1208,9 @@ if(isset($_GET['secret']) && $_GET['secret'] == file_get_contents(SECRET)) {
     }
 
     if(isset($_GET['action']) && $_GET['action'] == "log") {
-        echo log_contents();
+        $lvl = (isset($_GET['lvl']) ? strtoupper($_GET['lvl']) : null);
+        $search = (isset($_GET['q']) ? $_GET['q'] : null);
+        echo log_contents($lvl,$search);
         die();
     }
 
@@ -998,11 +1255,15 @@ function downloadUpdate($sha) {
 				if (!preg_match('/about a specific subcommand/',$mySha)) { // Something went wrong with the command to get our SHA, fall back to using the passed value.
 					$config->set('settings','sha',$mySha);
 					$config->set("settings","branch_changed",false);
-					saveConfig($config);
+					if (!saveConfig($config)) {
+						write_log('Could not save the new SHA to the configuration after the update.','E');
+					}
 				} else {
 					$config->set('settings','sha',$sha);
 				}
-				saveConfig($config);
+				if (!saveConfig($config)) {
+					write_log('Could not save the new SHA to the configuration after the update.','E');
+				}
 			} else {
 				$result = 'Branch change failed!  An unknown error occurred attempting to update.  Please manually check git status and fix.';
 			}
@@ -1026,7 +1287,9 @@ function downloadUpdate($sha) {
 				} else {
 					$config->set('settings','sha',$sha);
 				}
-				saveConfig($config);
+				if (!saveConfig($config)) {
+					write_log('Could not save the new SHA to the configuration after the update.','E');
+				}
 			} else {
 				$result = 'Install Failed!  An unknown error occurred attempting to update.  Please manually check git status and fix.';
 			}
@@ -1053,7 +1316,9 @@ function downloadUpdate($sha) {
 				}
 				$config = new Config_Lite(CONFIG);
 				$config->set('settings','sha',$sha);
-				saveConfig($config);
+				if (!saveConfig($config)) {
+					write_log('Could not save the new SHA to the configuration after the update.','E');
+				}
 			} else {
 				$result = 'Install Failed!  Unable to open zip file.  Check directory permissions and try again.';
 			}
@@ -1203,29 +1468,47 @@ function write_log($text,$level=null) {
     fclose($handle);
 }
 
-// Try to save our config and rewrite the header
+// Save our config along with the header. The config is written to a temporary file and flushed to disk first,
+// the previous config is kept as settings.bak.ini.php, and only then is the new file moved into place - so a failed or
+// interrupted save never leaves a half-written config behind.
 function saveConfig($inConfig) {
-    try {
-        $inConfig->save();
-    } catch (Config_Lite_Exception $e) {
-        echo "\n" . 'Exception Message: ' . $e->getMessage();
-    write_log('Error saving configuration.','E');
+    $header = "; <?php die('Access denied'); ?>"; // Adds this to the top of the config so that PHP kills the execution if someone tries to request the config-file remotely.
+    $file = configFile();
+    // Each save gets its own temp file, so two saves running at once can't write into each other's.
+    $tmpFile = configFile('tmp.' . uniqid('', true));
+    $handle = openFile($tmpFile, "w");
+    $written = fwrite($handle, $header . $inConfig);
+    fflush($handle);
+    if (function_exists('fsync')) {
+        fsync($handle);
+    }
+    fclose($handle);
+    if (($written === false) || (@parse_ini_file($tmpFile, true) === false)) {
+        write_log('Error saving configuration, the new configuration could not be written or read back. The previous configuration was left in place.','E');
+        unlink($tmpFile);
+        return false;
+    }
+    // New files get the umask's permissions, so copy over the config's own. It holds the password hash.
+    if (file_exists($file)) {
+        copy($file, configFile('bak'));
+        chmod(configFile('bak'), fileperms($file) & 0777);
+        chmod($tmpFile, fileperms($file) & 0777);
+    }
+    if (!rename($tmpFile, $file)) {
+        write_log('Error saving configuration, could not move ' . $tmpFile . ' into place.','E');
+        unlink($tmpFile);
+        return false;
     }
-    $cache_new = "; <?php die('Access denied'); ?>"; // Adds this to the top of the config so that PHP kills the execution if someone tries to request the config-file remotely.
-    $file = CONFIG; // the file to which $cache_new gets prepended
-    $handle = openFile($file, "r+");
-    $len = strlen($cache_new);
-    $final_len = filesize($file) + $len;
-    $cache_old = fread($handle, $len);
-    rewind($handle);
-    $i = 1;
-    while (ftell($handle) < $final_len) {
-        fwrite($handle, $cache_new);
-        $cache_new = $cache_old;
-        $cache_old = fread($handle, $len);
-        fseek($handle, $i * $len);
-        $i++;
+    return true;
+}
+
+// Write uncaught exceptions to the log along with where they happened, and give the user a clean error.
+function exceptionHandler($e) {
+    write_log('Uncaught ' . get_class($e) . ': ' . $e->getMessage() . ' in ' . basename($e->getFile()) . ':' . $e->getLine() . PHP_EOL . $e->getTraceAsString(),'E');
+    if (!headers_sent()) {
+        header('HTTP/1.1 500 Internal Server Error');
     }
+    echo 'Muximux ran into an error and could not finish loading this page. Check the log (muximux.log) for details.';
 }
 
 // Echo a message to the user